@@ -2,12 +2,15 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,24 +23,311 @@ import (
    3. No blocking and no locking. Everything is goroutines and channels
    4. There are one-per-connection goroutines to "handle" incoming lap/tag counts and outgoing notifications
    5. There are singleton goroutines to "service" the channels which mediate cross-goroutine communication
+   6. Notifications and tag reads are scoped to named topics (one per race, team or venue) so that
+      a /notify or /laps client only ever sees traffic for the topic it connected with
 */
 
+// defaultTopic is used when a client connects without a ?topic= query parameter,
+// preserving the pre-topic behaviour of a single shared stream.
+const defaultTopic = "default"
+
+// topicIdleTimeout is how long a topic with no subscribers is kept around before
+// serviceNotifyChannel reaps it.
+const topicIdleTimeout = 5 * time.Minute
+
+// notifyBufferSize is how many recent notifications each topic keeps around so a
+// reconnecting client can catch up on what it missed via the "since" param of
+// its subscribe call.
+const notifyBufferSize = 100
+
+// maxNotifyClients caps total /notify connections across all topics, so a flood of
+// spectator tabs can't exhaust server memory.
+const maxNotifyClients = 1000
+
+// Websocket keepalive timings for /notify, following the standard Gorilla
+// ping/pong pattern: the writer pings every pingPeriod, and the reader's
+// deadline is pushed out by pongWait on every pong so a dead TCP connection
+// is detected instead of piling up a goroutine forever.
+const (
+	notifyWriteWait  = 10 * time.Second
+	notifyPongWait   = 60 * time.Second
+	notifyPingPeriod = (notifyPongWait * 9) / 10
+)
+
+// notifyClient is one /notify websocket connection. Its subs map and nextSubID are
+// owned exclusively by serviceNotifyChannel, which is the only goroutine that ever
+// touches them, so no locking is needed.
 type notifyClient struct {
-	send chan Notification // if I knew how to make a channel of channels I wouldn't need this
+	topic     string
+	send      chan interface{} // RPCResponse or RPCNotification frames, written by notifyWriter
+	done      chan struct{}    // closed to force the writer goroutine to drop this client
+	subs      map[string]*subscription
+	nextSubID int
+}
+
+// subscription is one filtered event stream a /notify client asked for via the
+// JSON-RPC "subscribe" method.
+type subscription struct {
+	id     string
+	event  string
+	teamID *int // nil means "any team"
+}
+
+func (s *subscription) matches(event string, teamID int) bool {
+	if s.event != event {
+		return false
+	}
+	return s.teamID == nil || *s.teamID == teamID
+}
+
+// registerRequest is how handleNotify asks serviceNotifyChannel to admit a new client;
+// accepted carries back false if maxNotifyClients has been reached.
+type registerRequest struct {
+	client   *notifyClient
+	accepted chan bool
+}
+
+// RPCRequest is a JSON-RPC 2.0 request frame, as sent by a /notify client to
+// subscribe, unsubscribe, or list its active subscriptions.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// RPCResponse is the JSON-RPC 2.0 reply to an RPCRequest.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is the JSON-RPC 2.0 error object, using the standard reserved codes.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// RPCNotification is an unsolicited server-to-client frame carrying one event that
+// matched an active subscription.
+type RPCNotification struct {
+	JSONRPC string                `json:"jsonrpc"`
+	Method  string                `json:"method"` // always "notification"
+	Params  RPCNotificationParams `json:"params"`
+}
+
+type RPCNotificationParams struct {
+	Event        string      `json:"event"`
+	Subscription string      `json:"subscription"`
+	Data         interface{} `json:"data"`
+}
+
+// subscribeParams is the params object of a "subscribe" method call. Since is
+// optional and, if set, backfills matching notifications already in the topic's
+// ring buffer with seq greater than it, the same way ?since= did for the old
+// one-way push.
+type subscribeParams struct {
+	Event  string `json:"event"`
+	Filter struct {
+		TeamID *int `json:"team_id,omitempty"`
+	} `json:"filter"`
+	Since uint64 `json:"since,omitempty"`
+}
+
+// unsubscribeParams is the params object of an "unsubscribe" method call.
+type unsubscribeParams struct {
+	Subscription string `json:"subscription"`
+}
+
+// RPCServerShutdown is broadcast to every /notify client right before the server
+// closes their connection during a graceful shutdown.
+type RPCServerShutdown struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"` // always "server_shutdown"
+}
+
+// subscribeRequest, unsubscribeRequest and listSubsRequest let notifyReader hand a
+// parsed JSON-RPC call to serviceNotifyChannel, which owns client.subs and replies
+// on resp with the RPCResponse to send back.
+type subscribeRequest struct {
+	client *notifyClient
+	id     json.RawMessage
+	params subscribeParams
+	resp   chan RPCResponse
+}
+
+type unsubscribeRequest struct {
+	client *notifyClient
+	id     json.RawMessage
+	params unsubscribeParams
+	resp   chan RPCResponse
+}
+
+type listSubsRequest struct {
+	client *notifyClient
+	id     json.RawMessage
+	resp   chan RPCResponse
+}
+
+// supportedEvents are the event kinds a subscription may filter on. Each one
+// has a producer wired up below; race_state_changed isn't in this map because
+// nothing in the pipeline can detect a race-state change yet, and a subscribe
+// that accepts it would silently never fire.
+var supportedEvents = map[string]bool{
+	"lap_completed":  true,
+	"tag_read":       true,
+	"team_milestone": true,
+}
+
+// milestoneLapsPerMile approximates one mile on this 400m track, the same
+// conversion handleTeams uses for the admin dashboard's mileage total, and is
+// the boundary serviceTagChannel checks to emit a team_milestone alongside
+// lap_completed.
+const milestoneLapsPerMile = 4
+
+// isMilestoneLap reports whether laps lands exactly on a mile boundary.
+func isMilestoneLap(laps int) bool {
+	return laps > 0 && laps%milestoneLapsPerMile == 0
+}
+
+// HealthStats is the JSON body of GET /healthz.
+type HealthStats struct {
+	Topics          int   `json:"topics"`
+	Clients         int   `json:"clients"`
+	DroppedMessages int64 `json:"droppedMessages"`
+}
+
+// NotificationEnvelope is a classified event stamped with the per-topic monotonic
+// sequence number it was enqueued under. serviceNotifyChannel keeps a ring buffer
+// of these per topic so a subscription can backfill via its "since" param.
+type NotificationEnvelope struct {
+	Seq    uint64      `json:"seq"`
+	Event  string      `json:"event"`
+	TeamID int         `json:"teamId"`
+	Data   interface{} `json:"data"`
+}
+
+// topicTag is a tag read tagged with the topic it arrived on (so serviceTagChannel
+// can route the resulting Notification back to the right topic) and the reader
+// location it came from (e.g. "start", "finish"), for debounce logging.
+type topicTag struct {
+	topic  string
+	tag    int
+	reader string
+}
+
+// TagReadMessage is the structured read a reader location sends over /laps, replacing
+// the old bare tag-id integer so multiple reader locations can be distinguished.
+type TagReadMessage struct {
+	Tag    int    `json:"tag"`
+	Reader string `json:"reader"`
+	Ts     int64  `json:"ts"`
+}
+
+// debounceWindow is the minimum time between accepted reads of the same tag. It
+// filters the 10+ duplicate reads a single mat antenna pass produces, and doubles
+// as a minimum-lap-time floor no runner can legitimately beat.
+const debounceWindow = 5 * time.Second
+
+// tagDebounceKey scopes a debounced read by topic as well as tag, so the same
+// physical tag ID read on two different topics (two concurrent races, or a tag
+// reused across events) is never mistaken for a duplicate of the other.
+type tagDebounceKey struct {
+	topic string
+	tag   int
+}
+
+// tagDebouncer is owned single-threaded by serviceTagDebounce, so its map needs no
+// locking: only that goroutine ever reads svr.tags or touches lastAccepted.
+type tagDebouncer struct {
+	lastAccepted map[tagDebounceKey]time.Time
+}
+
+func newTagDebouncer() *tagDebouncer {
+	return &tagDebouncer{lastAccepted: make(map[tagDebounceKey]time.Time)}
+}
+
+// accept reports whether a read of tag on topic at now is outside the debounce
+// window, recording it as the new last-accepted read if so.
+func (d *tagDebouncer) accept(topic string, tag int, now time.Time) bool {
+	key := tagDebounceKey{topic: topic, tag: tag}
+	if last, ok := d.lastAccepted[key]; ok && now.Sub(last) < debounceWindow {
+		return false
+	}
+	d.lastAccepted[key] = now
+	return true
+}
+
+// topicNotification is one classified event to fan out to a topic's /notify
+// clients: the JSON-RPC event kind and team it concerns, plus the payload to
+// echo back as RPCNotificationParams.Data.
+type topicNotification struct {
+	topic  string
+	event  string
+	teamID int
+	data   interface{}
+}
+
+// topicState is the bookkeeping serviceNotifyChannel keeps per topic: who's listening,
+// when the topic was last touched (for idle garbage collection), and a ring buffer of
+// recent notifications (for backfill on reconnect).
+type topicState struct {
+	clients    map[*notifyClient]bool
+	lastActive time.Time
+	nextSeq    uint64
+	buffer     []NotificationEnvelope
+}
+
+// TopicInfo describes a topic for the GET /topics admin endpoint.
+type TopicInfo struct {
+	Name         string    `json:"name"`
+	Subscribers  int       `json:"subscribers"`
+	LastActivity time.Time `json:"lastActivity"`
 }
 
 type webServer struct {
 	ds *DataStore
 
-	// Incoming tag reads
-	tags     chan int
-	quitTags chan bool
+	// ctx is cancelled on SIGINT; per-connection goroutines (handleLaps, handleNotify,
+	// notifyReader and its handleRPCRequest calls) select on it so they never block
+	// forever talking to a service goroutine that has already shut down. notifyWriter
+	// stops when serviceNotifyChannel closes client.done on shutdown.
+	ctx context.Context
+
+	// Incoming tag reads: handleLaps publishes raw reads to tags, serviceTagDebounce
+	// drops duplicates and forwards the rest to acceptedTags for serviceTagChannel
+	tags         chan topicTag
+	acceptedTags chan topicTag
 
 	// Outgoing notifications
-	notify     chan Notification
-	quitNotify chan bool
-	register   chan *notifyClient
+	notify     chan topicNotification
+	register   chan registerRequest
 	unregister chan *notifyClient
+
+	// listTopics is used by handleTopics to ask serviceNotifyChannel for a
+	// snapshot of active topics, since the topic map is owned by that goroutine.
+	listTopics chan chan []TopicInfo
+
+	// health is used by handleHealthz to ask serviceNotifyChannel for client
+	// counts and dropped-message counters, since that state is owned by that goroutine.
+	health chan chan HealthStats
+
+	// JSON-RPC subscription management, dispatched here because client.subs is
+	// owned by serviceNotifyChannel
+	subscribe   chan subscribeRequest
+	unsubscribe chan unsubscribeRequest
+	listSubs    chan listSubsRequest
+}
+
+// topicParam extracts the ?topic= query parameter, falling back to defaultTopic
+// so existing single-stream clients keep working unchanged.
+func topicParam(r *http.Request) string {
+	if t := r.URL.Query().Get("topic"); t != "" {
+		return t
+	}
+	return defaultTopic
 }
 
 func (svr *webServer) handleRoot(w http.ResponseWriter, r *http.Request) {
@@ -133,9 +423,13 @@ func (svr *webServer) handleTeams(w http.ResponseWriter, r *http.Request) {
 
 var upgrader = websocket.Upgrader{}
 
-// handleLaps is the HTTP websocket handler for incoming tag reads from the RFID readers
+// handleLaps is the HTTP websocket handler for incoming tag reads from the RFID readers.
+// The ?topic= query parameter scopes the reads to a race, team or venue. Readers send
+// structured JSON messages, e.g. {"tag":123,"reader":"start","ts":...}, so multiple
+// reader locations can be distinguished.
 func (svr *webServer) handleLaps(w http.ResponseWriter, r *http.Request) {
 	log.Println("handleLaps starting")
+	topic := topicParam(r)
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("/laps/ upgrader.Upgrade: ", err)
@@ -144,23 +438,50 @@ func (svr *webServer) handleLaps(w http.ResponseWriter, r *http.Request) {
 	defer conn.Close()
 
 	for {
-		if _, msg, err := conn.ReadMessage(); err == nil {
-			tagID, err := strconv.Atoi(string(msg))
-			if err == nil {
-				svr.tags <- tagID // Publish tag reads to the tag channel
-			} else {
-				log.Println("strconv.Atoi: ", msg)
-			}
-		} else {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
 			log.Println("conn.ReadMessage: ", err)
 			break
 		}
+		var read TagReadMessage
+		if err := json.Unmarshal(msg, &read); err != nil {
+			log.Println("handleLaps json.Unmarshal: ", string(msg), err)
+			continue
+		}
+		select {
+		case svr.tags <- topicTag{topic: topic, tag: read.Tag, reader: read.Reader}: // Publish tag reads to the tag channel
+		case <-svr.ctx.Done():
+			log.Println("handleLaps exiting, server shutting down")
+			return
+		}
 	}
 	log.Println("handleLaps exiting")
 }
 
-// serviceTagChannel consumes the tag channel, allowing DB updates to be async with incoming tag reads
-func (svr *webServer) serviceTagChannel() {
+// serviceTagDebounce sits between handleLaps and serviceTagChannel, dropping repeat
+// reads of the same tag within debounceWindow before they ever reach the DB.
+func (svr *webServer) serviceTagDebounce(ctx context.Context) {
+	log.Println("serviceTagDebounce starting")
+	debouncer := newTagDebouncer()
+
+	for {
+		select {
+		case read := <-svr.tags:
+			if !debouncer.accept(read.topic, read.tag, time.Now()) {
+				log.Println("serviceTagDebounce dropping duplicate read, tag ", read.tag, " reader ", read.reader)
+				continue
+			}
+			svr.acceptedTags <- read
+
+		case <-ctx.Done():
+			log.Println("serviceTagDebounce exiting")
+			return
+		}
+	}
+}
+
+// serviceTagChannel consumes the accepted tag channel, allowing DB updates to be async with incoming tag reads
+func (svr *webServer) serviceTagChannel(ctx context.Context) {
 	log.Println("serviceTagChannel starting")
 	ds, err := ConnectToDB()
 	if err != nil {
@@ -171,72 +492,478 @@ func (svr *webServer) serviceTagChannel() {
 
 	for {
 		select {
-		case tagKey := <-svr.tags: // Consume the tag channel
-			if notif, err := ds.IncrementLaps(tagKey); err == nil {
-				svr.notify <- notif // Publish notification to the clients
+		case read := <-svr.acceptedTags: // Consume the accepted tag channel
+			log.Println("serviceTagChannel accepted tag ", read.tag, " reader ", read.reader)
+			if notif, err := ds.IncrementLaps(read.tag); err == nil {
+				events := []topicNotification{
+					{topic: read.topic, event: "tag_read", teamID: notif.TeamID,
+						data: TagReadMessage{Tag: read.tag, Reader: read.reader, Ts: time.Now().Unix()}},
+					{topic: read.topic, event: "lap_completed", teamID: notif.TeamID, data: notif},
+				}
+				if isMilestoneLap(notif.Laps) {
+					events = append(events, topicNotification{topic: read.topic, event: "team_milestone", teamID: notif.TeamID, data: notif})
+				}
+				for _, tn := range events {
+					select {
+					case svr.notify <- tn: // Publish notification to the topic's clients
+					case <-ctx.Done():
+						return
+					}
+				}
 			}
-		case <-svr.quitTags:
+		case <-ctx.Done():
 			log.Println("serviceTagChannel exiting")
 			return
 		}
 	}
 }
 
-// handleNotify is the HTTP websocket handler for browser clients to receive notifications
+// handleNotify is the HTTP websocket handler for browser clients to subscribe to
+// notifications. The ?topic= query parameter scopes the connection to a race, team
+// or venue; within that topic, the client drives a bidirectional JSON-RPC 2.0
+// protocol to subscribe/unsubscribe to specific event kinds (optionally filtered by
+// team_id), so a single socket can carry several filtered streams at once.
+//
+// Following the standard Gorilla hub pattern, the connection is handed off to a
+// dedicated reader goroutine (parses JSON-RPC requests, detects dead/closed
+// connections via ping/pong) and a dedicated writer goroutine (owns all writes, so
+// a single slow client can never block the rest of serviceNotifyChannel's fan-out).
 func (svr *webServer) handleNotify(w http.ResponseWriter, r *http.Request) {
+	topic := topicParam(r)
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("/notify upgrader.Upgrade ", err)
 		return
 	}
 
-	client := &notifyClient{send: make(chan Notification, 10)}
-	svr.register <- client
+	client := &notifyClient{
+		topic: topic,
+		send:  make(chan interface{}, notifyBufferSize+10),
+		done:  make(chan struct{}),
+	}
+
+	accepted := make(chan bool)
+	select {
+	case svr.register <- registerRequest{client: client, accepted: accepted}:
+	case <-svr.ctx.Done():
+		log.Println("/notify rejecting connection, server shutting down")
+		conn.Close()
+		return
+	}
+	if !<-accepted {
+		log.Println("/notify rejecting connection, maxNotifyClients reached")
+		conn.Close()
+		return
+	}
+
+	go svr.notifyWriter(conn, client)
+	svr.notifyReader(conn, client)
+}
+
+// notifyReader parses incoming JSON-RPC requests and keeps the read side alive so
+// dead connections are detected: it resets the pong deadline on every pong.
+func (svr *webServer) notifyReader(conn *websocket.Conn, client *notifyClient) {
+	defer func() {
+		select {
+		case svr.unregister <- client:
+		case <-svr.ctx.Done():
+		}
+		conn.Close()
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(notifyPongWait))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(notifyPongWait))
+		return nil
+	})
+
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		svr.handleRPCRequest(client, msg)
+	}
+}
+
+// handleRPCRequest parses one JSON-RPC 2.0 request frame and dispatches it to
+// serviceNotifyChannel, which owns client.subs, then queues the reply on
+// client.send for notifyWriter to deliver.
+func (svr *webServer) handleRPCRequest(client *notifyClient, raw []byte) {
+	if svr.ctx.Err() != nil {
+		return // server is shutting down; serviceNotifyChannel is no longer listening
+	}
+
+	var req RPCRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		client.send <- RPCResponse{JSONRPC: "2.0", Error: &RPCError{Code: -32700, Message: "parse error"}}
+		return
+	}
+
+	resp := make(chan RPCResponse)
+	switch req.Method {
+	case "subscribe":
+		var params subscribeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			client.send <- RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: -32602, Message: "invalid params"}}
+			return
+		}
+		if !supportedEvents[params.Event] {
+			client.send <- RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: -32602, Message: "unsupported event: " + params.Event}}
+			return
+		}
+		select {
+		case svr.subscribe <- subscribeRequest{client: client, id: req.ID, params: params, resp: resp}:
+		case <-svr.ctx.Done():
+			return
+		}
+
+	case "unsubscribe":
+		var params unsubscribeParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			client.send <- RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: -32602, Message: "invalid params"}}
+			return
+		}
+		select {
+		case svr.unsubscribe <- unsubscribeRequest{client: client, id: req.ID, params: params, resp: resp}:
+		case <-svr.ctx.Done():
+			return
+		}
+
+	case "list_subscriptions":
+		select {
+		case svr.listSubs <- listSubsRequest{client: client, id: req.ID, resp: resp}:
+		case <-svr.ctx.Done():
+			return
+		}
+
+	default:
+		client.send <- RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: -32601, Message: "method not found"}}
+		return
+	}
+
+	select {
+	case r := <-resp:
+		client.send <- r
+	case <-svr.ctx.Done():
+	}
+}
+
+// notifyWriter owns all writes to the connection: RPC responses, matched event
+// notifications, periodic pings, and the close frame sent when serviceNotifyChannel
+// evicts a slow client or shuts down.
+func (svr *webServer) notifyWriter(conn *websocket.Conn, client *notifyClient) {
+	ticker := time.NewTicker(notifyPingPeriod)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case notif := <-client.send:
-			// send the notification to the browser client
-			if err := conn.WriteJSON(notif); err != nil {
-				log.Println("WriteJSON: ", err)
-				svr.unregister <- client
+		case frame := <-client.send:
+			conn.SetWriteDeadline(time.Now().Add(notifyWriteWait))
+			if err := conn.WriteJSON(frame); err != nil {
+				log.Println("/notify WriteJSON: ", err)
 				return
 			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(notifyWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case <-client.done:
+			conn.SetWriteDeadline(time.Now().Add(notifyWriteWait))
+			closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "slow client evicted")
+			if svr.ctx.Err() != nil {
+				// Shutting down: flush queued frames (including the server_shutdown
+				// notice) before the close frame.
+				for len(client.send) > 0 {
+					if err := conn.WriteJSON(<-client.send); err != nil {
+						return
+					}
+				}
+				closeMsg = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			}
+			conn.WriteMessage(websocket.CloseMessage, closeMsg)
+			return
 		}
 	}
 }
 
-// serviceNotifyChannel is a waystation for notifications between the DB and the /notify handlers
-// it also provides a concurrency-safe map to fan out notifications to many clients
-func (svr *webServer) serviceNotifyChannel() {
+// handleTopics is the admin REST endpoint listing active topics with subscriber
+// counts and last-activity timestamps.
+func (svr *webServer) handleTopics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp := make(chan []TopicInfo)
+	select {
+	case svr.listTopics <- resp:
+	case <-svr.ctx.Done():
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	var topics []TopicInfo
+	select {
+	case topics = <-resp:
+	case <-svr.ctx.Done():
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(topics); err != nil {
+		log.Println("handleTopics json.Encode: ", err)
+	}
+}
+
+// handleHealthz reports /notify client counts and dropped-message counters for
+// liveness/readiness probes under systemd or Kubernetes.
+func (svr *webServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	resp := make(chan HealthStats)
+	select {
+	case svr.health <- resp:
+	case <-svr.ctx.Done():
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	var stats HealthStats
+	select {
+	case stats = <-resp:
+	case <-svr.ctx.Done():
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Println("handleHealthz json.Encode: ", err)
+	}
+}
+
+// serviceNotifyChannel is a waystation for notifications between the DB and the /notify handlers.
+// It owns the topics map so that register/unregister/notify/list/idle-GC never race each other.
+func (svr *webServer) serviceNotifyChannel(ctx context.Context) {
 	log.Println("serviceNotifyChannel starting")
-	clients := make(map[*notifyClient]bool)
+	topics := make(map[string]*topicState)
+	totalClients := 0
+	var droppedMessages int64
+
+	reap := time.NewTicker(time.Minute)
+	defer reap.Stop()
 
 	for {
 		select {
-		case r := <-svr.register:
-			clients[r] = true
-		case ur := <-svr.unregister:
-			delete(clients, ur)
-		case notif := <-svr.notify:
-			for client := range clients {
-				client.send <- notif // send the notification to running /notify handlers
+		case req := <-svr.register:
+			if totalClients >= maxNotifyClients {
+				req.accepted <- false
+				continue
+			}
+			state, ok := topics[req.client.topic]
+			if !ok {
+				state = &topicState{clients: make(map[*notifyClient]bool)}
+				topics[req.client.topic] = state
+			}
+			state.clients[req.client] = true
+			totalClients++
+			state.lastActive = time.Now()
+			req.accepted <- true
+
+		case client := <-svr.unregister:
+			if state, ok := topics[client.topic]; ok {
+				if _, ok := state.clients[client]; ok {
+					delete(state.clients, client)
+					totalClients--
+				}
+			}
+
+		case tn := <-svr.notify:
+			state, ok := topics[tn.topic]
+			if !ok {
+				state = &topicState{clients: make(map[*notifyClient]bool)}
+				topics[tn.topic] = state
+			}
+			state.lastActive = time.Now()
+			state.nextSeq++
+			env := NotificationEnvelope{Seq: state.nextSeq, Event: tn.event, TeamID: tn.teamID, Data: tn.data}
+			state.buffer = append(state.buffer, env)
+			if len(state.buffer) > notifyBufferSize {
+				state.buffer = state.buffer[len(state.buffer)-notifyBufferSize:]
+			}
+
+			for client := range state.clients {
+				evicted := false
+				for _, sub := range client.subs {
+					if !sub.matches(tn.event, tn.teamID) {
+						continue
+					}
+					frame := RPCNotification{
+						JSONRPC: "2.0",
+						Method:  "notification",
+						Params: RPCNotificationParams{
+							Event:        tn.event,
+							Subscription: sub.id,
+							Data:         tn.data,
+						},
+					}
+					select {
+					case client.send <- frame: // deliver to this matched subscription
+					default:
+						evicted = true
+					}
+					if evicted {
+						break
+					}
+				}
+				if evicted {
+					// client.send is full: the browser isn't keeping up. Evict it instead
+					// of blocking the whole fan-out on one slow tab.
+					log.Println("serviceNotifyChannel evicting slow client on topic ", tn.topic)
+					delete(state.clients, client)
+					totalClients--
+					droppedMessages++
+					close(client.done)
+				}
+			}
+
+		case req := <-svr.subscribe:
+			state, ok := topics[req.client.topic]
+			if !ok {
+				state = &topicState{clients: make(map[*notifyClient]bool)}
+				topics[req.client.topic] = state
+			}
+			req.client.nextSubID++
+			sub := &subscription{
+				id:     fmt.Sprintf("sub%d", req.client.nextSubID),
+				event:  req.params.Event,
+				teamID: req.params.Filter.TeamID,
+			}
+			if req.client.subs == nil {
+				req.client.subs = make(map[string]*subscription)
+			}
+			req.client.subs[sub.id] = sub
+
+			if req.params.Since > 0 { // backfill what this subscription missed
+				for _, env := range state.buffer {
+					if env.Seq <= req.params.Since {
+						continue
+					}
+					if !sub.matches(env.Event, env.TeamID) {
+						continue
+					}
+					select {
+					case req.client.send <- RPCNotification{
+						JSONRPC: "2.0",
+						Method:  "notification",
+						Params: RPCNotificationParams{
+							Event:        env.Event,
+							Subscription: sub.id,
+							Data:         env.Data,
+						},
+					}:
+					default:
+					}
+				}
+			}
+			select {
+			case req.resp <- RPCResponse{JSONRPC: "2.0", ID: req.id, Result: sub.id}:
+			case <-ctx.Done():
+			}
+
+		case req := <-svr.unsubscribe:
+			var r RPCResponse
+			if _, ok := req.client.subs[req.params.Subscription]; ok {
+				delete(req.client.subs, req.params.Subscription)
+				r = RPCResponse{JSONRPC: "2.0", ID: req.id, Result: true}
+			} else {
+				r = RPCResponse{JSONRPC: "2.0", ID: req.id, Error: &RPCError{Code: -32602, Message: "unknown subscription"}}
+			}
+			select {
+			case req.resp <- r:
+			case <-ctx.Done():
+			}
+
+		case req := <-svr.listSubs:
+			ids := make([]string, 0, len(req.client.subs))
+			for id := range req.client.subs {
+				ids = append(ids, id)
+			}
+			select {
+			case req.resp <- RPCResponse{JSONRPC: "2.0", ID: req.id, Result: ids}:
+			case <-ctx.Done():
+			}
+
+		case resp := <-svr.listTopics:
+			infos := make([]TopicInfo, 0, len(topics))
+			for name, state := range topics {
+				infos = append(infos, TopicInfo{
+					Name:         name,
+					Subscribers:  len(state.clients),
+					LastActivity: state.lastActive,
+				})
+			}
+			resp <- infos
+
+		case resp := <-svr.health:
+			resp <- HealthStats{
+				Topics:          len(topics),
+				Clients:         totalClients,
+				DroppedMessages: droppedMessages,
+			}
+
+		case <-reap.C:
+			for name, state := range topics {
+				if len(state.clients) == 0 && time.Since(state.lastActive) > topicIdleTimeout {
+					delete(topics, name)
+					log.Println("serviceNotifyChannel reaped idle topic ", name)
+				}
+			}
+
+		case <-ctx.Done():
+			// Broadcast a shutdown notice to every connected client and force their
+			// writer goroutines to send a clean close frame before we go away.
+			for _, state := range topics {
+				for client := range state.clients {
+					select {
+					case client.send <- RPCServerShutdown{JSONRPC: "2.0", Method: "server_shutdown"}:
+					default:
+					}
+					close(client.done)
+				}
 			}
-		case <-svr.quitNotify:
 			log.Println("serviceNotifyChannel exiting")
 			return
 		}
 	}
 }
 
+// shutdownTimeout is the deadline given to httpsvr.Shutdown on SIGINT for in-flight
+// HTTP requests to finish. Shutdown does not wait for the hijacked /laps and /notify
+// websocket connections, and StartWebServer itself waits only for its service
+// goroutines (wg below).
+const shutdownTimeout = 10 * time.Second
+
 // StartWebServer starts and stops the app and its goroutines
 func StartWebServer() {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	svr := &webServer{
-		tags:       make(chan int, 10),
-		quitTags:   make(chan bool),
-		notify:     make(chan Notification, 10),
-		quitNotify: make(chan bool),
-		register:   make(chan *notifyClient),
-		unregister: make(chan *notifyClient),
+		ctx:          ctx,
+		tags:         make(chan topicTag, 10),
+		acceptedTags: make(chan topicTag, 10),
+		notify:       make(chan topicNotification, 10),
+		register:     make(chan registerRequest),
+		unregister:   make(chan *notifyClient),
+		listTopics:   make(chan chan []TopicInfo),
+		health:       make(chan chan HealthStats),
+
+		subscribe:   make(chan subscribeRequest),
+		unsubscribe: make(chan unsubscribeRequest),
+		listSubs:    make(chan listSubsRequest),
 	}
 
 	var httpsvr http.Server
@@ -246,8 +973,12 @@ func StartWebServer() {
 	go func() {
 		<-quit
 		log.Println("received os.Interrupt")
-		if err := httpsvr.Shutdown(context.Background()); err != nil {
-			log.Fatalf("Shutdown: %v\n", err)
+		cancel() // tell every goroutine to wind down, including broadcasting to /notify clients
+
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer shutdownCancel()
+		if err := httpsvr.Shutdown(shutdownCtx); err != nil {
+			log.Println("Shutdown: ", err)
 		}
 	}()
 
@@ -256,19 +987,22 @@ func StartWebServer() {
 	http.HandleFunc("/teams", svr.handleTeams)
 	http.HandleFunc("/laps", svr.handleLaps)
 	http.HandleFunc("/notify", svr.handleNotify)
+	http.HandleFunc("/topics", svr.handleTopics)
+	http.HandleFunc("/healthz", svr.handleHealthz)
 	http.Handle("/templates/", http.StripPrefix("/templates/", http.FileServer(http.Dir("./templates"))))
 	http.Handle("/clients/", http.StripPrefix("/clients/", http.FileServer(http.Dir("./clients"))))
 
-	go svr.serviceTagChannel()
-	go svr.serviceNotifyChannel()
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() { defer wg.Done(); svr.serviceTagDebounce(ctx) }()
+	go func() { defer wg.Done(); svr.serviceTagChannel(ctx) }()
+	go func() { defer wg.Done(); svr.serviceNotifyChannel(ctx) }()
 
 	if err := httpsvr.ListenAndServe(); err != http.ErrServerClosed {
 		log.Println("http.ListenAndServe: ", err)
 	}
-	svr.quitTags <- true
-	svr.quitNotify <- true
 
-	// Wait for goroutines to quit so we close the DB cleanly
-	// I thought unbuffered channels were synchronous so this seems odd
-	time.Sleep(time.Second)
+	// Wait for the service goroutines to finish winding down (and, for
+	// serviceTagChannel, close its DB connection) before the process exits.
+	wg.Wait()
 }